@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abhirockzz/cosmos-go-rate-limiting/ratelimit"
+	"github.com/gocql/gocql"
+)
+
+// Order is a single row of the orders table, as accepted by /orders/bulk.
+type Order struct {
+	ID     string    `json:"id"`
+	Amount int       `json:"amount"`
+	State  string    `json:"state"`
+	Time   time.Time `json:"time"`
+}
+
+// ItemStatus describes the outcome of a single order within a bulk request.
+type ItemStatus string
+
+const (
+	// StatusSuccess means the order was written.
+	StatusSuccess ItemStatus = "success"
+	// StatusThrottledRetried means the order's sub-batch failed at least
+	// once (a 429 or any other error the retry policy retries) and then
+	// succeeded on a retry.
+	StatusThrottledRetried ItemStatus = "429-retried"
+	// StatusFailed means the order could not be written.
+	StatusFailed ItemStatus = "failed"
+)
+
+// ItemResult is the per-order outcome returned by BulkAdd.
+type ItemResult struct {
+	ID     string     `json:"id"`
+	Status ItemStatus `json:"status"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// idempotencyCache deduplicates retried bulk HTTP requests that carry the
+// same Idempotency-Key, so a client-side retry after a dropped response
+// doesn't double-insert.
+var idempotencyCache sync.Map // map[string][]ItemResult
+
+// BulkAdd handles POST /orders/bulk: it accepts a JSON array of orders,
+// splits them into per-partition sub-batches bounded by cfg.Batch, and
+// writes each sub-batch with gocql batches, the configured retry policy and
+// the adaptive rate limiter.
+func BulkAdd(rw http.ResponseWriter, req *http.Request) {
+	idempotencyKey := req.Header.Get("Idempotency-Key")
+	if idempotencyKey != "" {
+		if cached, ok := idempotencyCache.Load(idempotencyKey); ok {
+			writeBulkResponse(rw, cached.([]ItemResult))
+			return
+		}
+	}
+
+	var orders []Order
+	if err := json.NewDecoder(req.Body).Decode(&orders); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batches := splitIntoSubBatches(orders, cfg.Batch.MaxStatements, cfg.Batch.MaxBytes)
+
+	results := make([]ItemResult, 0, len(orders))
+	for _, b := range batches {
+		results = append(results, execSubBatch(req.Context(), b)...)
+	}
+
+	if idempotencyKey != "" {
+		idempotencyCache.Store(idempotencyKey, results)
+	}
+
+	writeBulkResponse(rw, results)
+}
+
+func writeBulkResponse(rw http.ResponseWriter, results []ItemResult) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(results)
+}
+
+// splitIntoSubBatches groups orders by partition key (id, in this schema)
+// into sub-batches capped at maxStatements statements or maxBytes estimated
+// bytes. Every sub-batch holds statements from exactly one partition - Cosmos
+// DB rejects batches spanning more than one partition key - so a partition
+// boundary always starts a new sub-batch even if the cap hasn't been hit; a
+// single partition that alone exceeds the cap is instead split across
+// multiple sub-batches.
+func splitIntoSubBatches(orders []Order, maxStatements, maxBytes int) [][]Order {
+	byPartition := make(map[string][]Order)
+	var partitionKeys []string
+	for _, o := range orders {
+		if _, seen := byPartition[o.ID]; !seen {
+			partitionKeys = append(partitionKeys, o.ID)
+		}
+		byPartition[o.ID] = append(byPartition[o.ID], o)
+	}
+
+	var subBatches [][]Order
+	var current []Order
+	var currentBytes int
+
+	flush := func() {
+		if len(current) > 0 {
+			subBatches = append(subBatches, current)
+			current = nil
+			currentBytes = 0
+		}
+	}
+
+	for _, key := range partitionKeys {
+		flush() // never mix statements from different partitions into one batch
+
+		for _, o := range byPartition[key] {
+			orderBytes := estimateBytes([]Order{o})
+
+			exceedsStatements := len(current)+1 > maxStatements
+			exceedsBytes := currentBytes+orderBytes > maxBytes
+			if len(current) > 0 && (exceedsStatements || exceedsBytes) {
+				flush()
+			}
+
+			current = append(current, o)
+			currentBytes += orderBytes
+		}
+	}
+	flush()
+
+	return subBatches
+}
+
+// estimateBytes gives a rough size estimate for a set of orders, good
+// enough to guard against Cosmos DB's batch size limit without needing to
+// actually serialize the CQL statements.
+func estimateBytes(orders []Order) int {
+	const perOrderOverhead = 32
+	total := 0
+	for _, o := range orders {
+		total += len(o.ID) + len(o.State) + perOrderOverhead
+	}
+	return total
+}
+
+// execSubBatch writes one partition-aligned sub-batch, acquiring one rate
+// limiter token per statement in the batch (not one per batch - otherwise a
+// 100-statement batch would cost the same single token as a single insert,
+// letting /orders/bulk blow straight through the configured RU rate) and
+// relying on the session's configured retry policy for 429s.
+func execSubBatch(ctx context.Context, orders []Order) []ItemResult {
+	results := make([]ItemResult, len(orders))
+	for i, o := range orders {
+		results[i] = ItemResult{ID: o.ID, Status: StatusSuccess}
+	}
+
+	for range orders {
+		if err := limiter.Acquire(ctx); err != nil {
+			return failAll(orders, err)
+		}
+	}
+
+	batchType := gocql.LoggedBatch
+	if cfg.Batch.Unlogged {
+		batchType = gocql.UnloggedBatch
+	}
+	batch := cs.NewBatch(batchType).WithContext(ctx)
+	for _, o := range orders {
+		batch.Query(insertQuery, o.ID, o.Amount, o.State, o.Time)
+	}
+
+	observer := &bulkBatchObserver{}
+	batch.Observer(observer)
+	err := cs.ExecuteBatch(batch)
+
+	if err != nil {
+		if strings.Contains(err.Error(), "TooManyRequests (429)") {
+			limiter.OnThrottled(ratelimit.ParseRetryAfter(err.Error(), time.Second))
+		}
+		return failAll(orders, err)
+	}
+
+	limiter.OnSuccess()
+	if observer.attempt > 0 {
+		for i := range results {
+			results[i].Status = StatusThrottledRetried
+		}
+	}
+	return results
+}
+
+// bulkBatchObserver is a gocql.BatchObserver that records whether a batch
+// needed a retry, so execSubBatch can report StatusThrottledRetried.
+type bulkBatchObserver struct {
+	attempt int
+}
+
+// ObserveBatch records the batch's attempt count and, on success, reports
+// back to the circuit breaker the same way main.go's OrderInsertErrorLogger
+// does for single inserts - gocql's RetryPolicy is only ever consulted on
+// error, so without this a breaker tripped by bulk-only traffic would never
+// see the RecordSuccess that clears its half-open probe.
+func (o *bulkBatchObserver) ObserveBatch(ctx context.Context, ob gocql.ObservedBatch) {
+	o.attempt = ob.Attempt
+	if ob.Err == nil && breaker != nil {
+		breaker.RecordSuccess()
+	}
+}
+
+func failAll(orders []Order, err error) []ItemResult {
+	results := make([]ItemResult, len(orders))
+	for i, o := range orders {
+		results[i] = ItemResult{ID: o.ID, Status: StatusFailed, Error: err.Error()}
+	}
+	return results
+}
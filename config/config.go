@@ -0,0 +1,343 @@
+// Package config loads the structured connection/auth/tls/schema/retry
+// configuration used to talk to Azure Cosmos DB's Cassandra API (or a plain
+// Cassandra cluster, for local development) and turns it into a
+// *gocql.ClusterConfig.
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abhirockzz/cosmos-go-rate-limiting/retry"
+	"github.com/abhirockzz/cosmos-go-rate-limiting/shard"
+	"github.com/gocql/gocql"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the top-level, grouped configuration for connecting to Cosmos
+// DB's Cassandra API. It is loaded from YAML, with individual fields
+// overridable via environment variables so the same config file can be
+// reused across environments (e.g. local Cassandra vs. Cosmos DB).
+type Config struct {
+	Connection ConnectionConfig `yaml:"connection"`
+	Auth       AuthConfig       `yaml:"auth"`
+	TLS        TLSConfig        `yaml:"tls"`
+	Schema     SchemaConfig     `yaml:"schema"`
+	Retry      RetryConfig      `yaml:"retry"`
+	Batch      BatchConfig      `yaml:"batch"`
+}
+
+// ConnectionConfig configures the gocql cluster connection itself.
+type ConnectionConfig struct {
+	ContactPoints            []string      `yaml:"contact_points"`
+	Port                     int           `yaml:"port"`
+	ProtoVersion             int           `yaml:"protocol_version"`
+	ConnectTimeout           time.Duration `yaml:"connect_timeout"`
+	Timeout                  time.Duration `yaml:"timeout"`
+	HostSelectionPolicy      string        `yaml:"host_selection_policy"`
+	DisableInitialHostLookup bool          `yaml:"disable_initial_host_lookup"`
+	ShardAware               bool          `yaml:"shard_aware"`
+	ShardAwarePort           int           `yaml:"shard_aware_port"`
+}
+
+// AuthConfig groups the supported authentication mechanisms. Only Basic is
+// supported today, mirroring gocql.PasswordAuthenticator.
+type AuthConfig struct {
+	Basic BasicAuthConfig `yaml:"basic"`
+}
+
+// BasicAuthConfig is username/password authentication. Password can be
+// supplied directly or, for container/K8s deployments where secrets are
+// mounted as files, via PasswordFile.
+type BasicAuthConfig struct {
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+}
+
+// TLSConfig configures the TLS transport used to reach Cosmos DB. Disabled
+// lets it be turned off entirely for a plain local Cassandra cluster, which
+// doesn't terminate TLS on its CQL port.
+type TLSConfig struct {
+	Disabled         bool   `yaml:"disabled"`
+	CAPath           string `yaml:"ca_path"`
+	CertPath         string `yaml:"cert_path"`
+	KeyPath          string `yaml:"key_path"`
+	Insecure         bool   `yaml:"insecure"`
+	MinVersion       string `yaml:"min_version"`
+	HostVerification bool   `yaml:"host_verification"`
+}
+
+// SchemaConfig identifies the keyspace/table this service operates on.
+type SchemaConfig struct {
+	Keyspace          string `yaml:"keyspace"`
+	Table             string `yaml:"table"`
+	Consistency       string `yaml:"consistency"`
+	ReplicationFactor int    `yaml:"replication_factor"`
+}
+
+// RetryConfig selects and configures one of the retry package's policies.
+type RetryConfig struct {
+	// Policy selects the retry strategy: "cosmos" (default), "jitter",
+	// "breaker" or "none".
+	Policy         string        `yaml:"policy"`
+	MaxRetries     int           `yaml:"max_retries"`
+	GrowingBackoff time.Duration `yaml:"growing_backoff"`
+	FixedBackoff   time.Duration `yaml:"fixed_backoff"`
+
+	// JitterBase and JitterCap configure the "jitter" policy.
+	JitterBase time.Duration `yaml:"jitter_base"`
+	JitterCap  time.Duration `yaml:"jitter_cap"`
+
+	// BreakerFailureThreshold and BreakerOpenDuration configure the
+	// "breaker" policy, which wraps the cosmos policy.
+	BreakerFailureThreshold int           `yaml:"breaker_failure_threshold"`
+	BreakerOpenDuration     time.Duration `yaml:"breaker_open_duration"`
+}
+
+// BatchConfig bounds how /orders/bulk splits an incoming batch of writes
+// into per-partition sub-batches, since Cosmos DB rejects large
+// cross-partition or oversized batches.
+type BatchConfig struct {
+	MaxStatements int  `yaml:"max_statements"`
+	MaxBytes      int  `yaml:"max_bytes"`
+	Unlogged      bool `yaml:"unlogged"`
+}
+
+// Load reads the YAML config at path, then applies environment variable
+// overrides on top (see applyEnvOverrides) so operators can switch between
+// Cosmos DB and a local Cassandra, or inject secrets, without recompiling.
+func Load(path string) (*Config, error) {
+	var cfg Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	if err := cfg.applyEnvOverrides(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.resolvePassword(); err != nil {
+		return nil, err
+	}
+
+	cfg.applyBatchDefaults()
+	cfg.applyRetryDefaults()
+
+	return &cfg, nil
+}
+
+// applyBatchDefaults fills in the batch-splitting limits when the config
+// file leaves them unset.
+func (c *Config) applyBatchDefaults() {
+	if c.Batch.MaxStatements <= 0 {
+		c.Batch.MaxStatements = 100
+	}
+	if c.Batch.MaxBytes <= 0 {
+		c.Batch.MaxBytes = 1 << 20 // ~1MB
+	}
+}
+
+// applyRetryDefaults fills in the jitter/breaker tuning knobs when the
+// config file leaves them unset.
+func (c *Config) applyRetryDefaults() {
+	if c.Retry.JitterBase <= 0 {
+		c.Retry.JitterBase = 100 * time.Millisecond
+	}
+	if c.Retry.JitterCap <= 0 {
+		c.Retry.JitterCap = 10 * time.Second
+	}
+	if c.Retry.BreakerFailureThreshold <= 0 {
+		c.Retry.BreakerFailureThreshold = 5
+	}
+	if c.Retry.BreakerOpenDuration <= 0 {
+		c.Retry.BreakerOpenDuration = 30 * time.Second
+	}
+}
+
+// applyEnvOverrides layers environment variables on top of the YAML config,
+// preserving the env var names the service has historically used.
+func (c *Config) applyEnvOverrides() error {
+	if v := os.Getenv("COSMOSDB_CASSANDRA_CONTACT_POINT"); v != "" {
+		c.Connection.ContactPoints = strings.Split(v, ",")
+	}
+	if v := os.Getenv("COSMOSDB_CASSANDRA_USER"); v != "" {
+		c.Auth.Basic.Username = v
+	}
+	if v := os.Getenv("COSMOSDB_CASSANDRA_PASSWORD"); v != "" {
+		c.Auth.Basic.Password = v
+	}
+	if v := os.Getenv("COSMOSDB_CASSANDRA_KEYSPACE"); v != "" {
+		c.Schema.Keyspace = v
+	}
+	if v := os.Getenv("COSMOSDB_CASSANDRA_TABLE"); v != "" {
+		c.Schema.Table = v
+	}
+	if v := os.Getenv("MAX_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid MAX_RETRIES: %w", err)
+		}
+		c.Retry.MaxRetries = n
+	}
+	if v := os.Getenv("SHARD_AWARE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid SHARD_AWARE: %w", err)
+		}
+		c.Connection.ShardAware = b
+	}
+	if v := os.Getenv("RETRY_POLICY"); v != "" {
+		c.Retry.Policy = v
+	}
+	return nil
+}
+
+// resolvePassword reads Auth.Basic.PasswordFile when set, so a password can
+// be mounted as a file (e.g. a Kubernetes secret volume) instead of living
+// in the environment or the config file.
+func (c *Config) resolvePassword() error {
+	if c.Auth.Basic.PasswordFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.Auth.Basic.PasswordFile)
+	if err != nil {
+		return fmt.Errorf("reading password_file %s: %w", c.Auth.Basic.PasswordFile, err)
+	}
+	c.Auth.Basic.Password = strings.TrimSpace(string(data))
+	return nil
+}
+
+// BuildCluster turns Config into a *gocql.ClusterConfig ready for
+// CreateSession, applying the connection, auth, TLS and retry groups.
+func (c *Config) BuildCluster() *gocql.ClusterConfig {
+	cluster := gocql.NewCluster(c.Connection.ContactPoints...)
+
+	if c.Connection.Port != 0 {
+		cluster.Port = c.Connection.Port
+	}
+	if c.Connection.ProtoVersion != 0 {
+		cluster.ProtoVersion = c.Connection.ProtoVersion
+	}
+	if c.Connection.ConnectTimeout != 0 {
+		cluster.ConnectTimeout = c.Connection.ConnectTimeout
+	}
+	if c.Connection.Timeout != 0 {
+		cluster.Timeout = c.Connection.Timeout
+	}
+	cluster.DisableInitialHostLookup = c.Connection.DisableInitialHostLookup
+
+	shard.Apply(cluster, shard.Config{
+		HostSelectionPolicy: hostSelectionPolicy(c.Connection.HostSelectionPolicy),
+		Enabled:             c.Connection.ShardAware,
+		Port:                c.Connection.ShardAwarePort,
+	})
+
+	cluster.Authenticator = gocql.PasswordAuthenticator{
+		Username: c.Auth.Basic.Username,
+		Password: c.Auth.Basic.Password,
+	}
+
+	if !c.TLS.Disabled {
+		cluster.SslOpts = &gocql.SslOptions{
+			Config:                 &tls.Config{MinVersion: tlsMinVersion(c.TLS.MinVersion)},
+			CaPath:                 c.TLS.CAPath,
+			CertPath:               c.TLS.CertPath,
+			KeyPath:                c.TLS.KeyPath,
+			EnableHostVerification: c.TLS.HostVerification,
+		}
+		if c.TLS.Insecure {
+			cluster.SslOpts.Config.InsecureSkipVerify = true
+		}
+	}
+
+	if consistency, ok := parseConsistency(c.Schema.Consistency); ok {
+		cluster.Consistency = consistency
+	}
+
+	cluster.RetryPolicy = c.Retry.buildPolicy()
+
+	return cluster
+}
+
+// buildPolicy selects and constructs the configured gocql.RetryPolicy:
+// "cosmos" (default), "jitter", "breaker" or "none".
+func (r RetryConfig) buildPolicy() gocql.RetryPolicy {
+	cosmos := func() *retry.CosmosRetryPolicy {
+		p := retry.NewCosmosRetryPolicy(r.MaxRetries)
+		p.GrowingBackoff = r.GrowingBackoff
+		if r.FixedBackoff > 0 {
+			p.FixedBackoff = r.FixedBackoff
+		}
+		return p
+	}
+
+	switch strings.ToLower(r.Policy) {
+	case "none":
+		return nil
+	case "jitter":
+		return retry.NewExponentialJitterPolicy(r.JitterBase, 0, r.JitterCap, r.MaxRetries)
+	case "breaker":
+		return retry.NewCircuitBreakerPolicy(cosmos(), r.BreakerFailureThreshold, r.BreakerOpenDuration)
+	default: // "cosmos", or unset
+		if r.MaxRetries <= 0 {
+			return nil
+		}
+		return cosmos()
+	}
+}
+
+// parseConsistency maps a config string to a gocql.Consistency, returning
+// ok=false for an empty or unrecognized value so callers can fall back to
+// gocql's own default.
+func parseConsistency(s string) (gocql.Consistency, bool) {
+	consistencies := map[string]gocql.Consistency{
+		"any":          gocql.Any,
+		"one":          gocql.One,
+		"two":          gocql.Two,
+		"three":        gocql.Three,
+		"quorum":       gocql.Quorum,
+		"all":          gocql.All,
+		"local_quorum": gocql.LocalQuorum,
+		"each_quorum":  gocql.EachQuorum,
+		"local_one":    gocql.LocalOne,
+	}
+	c, ok := consistencies[strings.ToLower(s)]
+	return c, ok
+}
+
+// hostSelectionPolicy maps connection.host_selection_policy to a
+// gocql.HostSelectionPolicy, returning nil for "token_aware", empty, or an
+// unrecognized value so shard.Apply falls back to its token-aware default.
+func hostSelectionPolicy(s string) gocql.HostSelectionPolicy {
+	switch strings.ToLower(s) {
+	case "round_robin":
+		return gocql.RoundRobinHostPolicy()
+	default: // "token_aware", or unset
+		return nil
+	}
+}
+
+// tlsMinVersion maps a config string ("1.0".."1.3") to its crypto/tls
+// constant, defaulting to TLS 1.2 as Cosmos DB requires.
+func tlsMinVersion(v string) uint16 {
+	switch v {
+	case "1.0":
+		return tls.VersionTLS10
+	case "1.1":
+		return tls.VersionTLS11
+	case "1.3":
+		return tls.VersionTLS13
+	default:
+		return tls.VersionTLS12
+	}
+}
@@ -0,0 +1,70 @@
+// Package cqljson turns arbitrary CQL query results into JSON-friendly
+// maps without requiring a hand-written struct per query, using gocql's
+// reflection-based RowData/Scan support.
+package cqljson
+
+import (
+	"reflect"
+
+	"github.com/gocql/gocql"
+)
+
+// Query runs cql with args and returns every row as a map of column name to
+// value, ready to be marshalled as JSON.
+func Query(session *gocql.Session, cql string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, _, err := QueryPage(session, cql, 0, nil, args...)
+	return rows, err
+}
+
+// QueryPage runs cql with args, fetching at most pageSize rows starting
+// from pageState (both as produced by gocql's paging API), and returns the
+// rows plus the PageState to pass to the next call. pageSize <= 0 means use
+// gocql's default page size; a nil/empty returned page state means there
+// are no more pages.
+func QueryPage(session *gocql.Session, cql string, pageSize int, pageState []byte, args ...interface{}) ([]map[string]interface{}, []byte, error) {
+	query := session.Query(cql, args...)
+	if pageSize > 0 {
+		// Setting PageState, even to nil for the first page, turns off
+		// gocql's automatic fetching of later pages, so the iterator stops
+		// after this one page.
+		query = query.PageSize(pageSize).PageState(pageState)
+	} else if len(pageState) > 0 {
+		query = query.PageState(pageState)
+	}
+
+	iter := query.Iter()
+
+	rd, err := iter.RowData()
+	if err != nil {
+		iter.Close()
+		return nil, nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0)
+	for iter.Scan(rd.Values...) {
+		rows = append(rows, rowToMap(rd.Columns, rd.Values))
+	}
+
+	nextPageState := iter.PageState()
+	if err := iter.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	return rows, nextPageState, nil
+}
+
+// rowToMap pairs column names with their scanned values, unwrapping the
+// pointers gocql's RowData hands back so the result marshals as plain JSON
+// values rather than pointer addresses.
+func rowToMap(columns []string, values []interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(columns))
+	for i, col := range columns {
+		v := reflect.Indirect(reflect.ValueOf(values[i]))
+		if v.IsValid() {
+			m[col] = v.Interface()
+		} else {
+			m[col] = nil
+		}
+	}
+	return m
+}
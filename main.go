@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"log"
 	"math/rand"
@@ -14,91 +14,123 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/abhirockzz/cosmos-cassandra-go-extension/retry"
+	"github.com/abhirockzz/cosmos-go-rate-limiting/config"
+	"github.com/abhirockzz/cosmos-go-rate-limiting/ratelimit"
+	"github.com/abhirockzz/cosmos-go-rate-limiting/retry"
+	"github.com/abhirockzz/cosmos-go-rate-limiting/shard"
 	"github.com/gocql/gocql"
 	"github.com/hashicorp/go-uuid"
 )
 
 var (
-	// connection
-	cosmosCassandraContactPoint string
-	cosmosCassandraUser         string
-	cosmosCassandraPassword     string
-
-	keyspace string
-	table    string
+	cfg *config.Config
 
 	cs          *gocql.Session
 	insertQuery string
 
-	useRetryPolicy bool
+	limiter ratelimit.Limiter
+
+	// breaker is non-nil when RetryConfig.Policy is "breaker"; ObserveQuery
+	// uses it to report successes back to the circuit breaker, since gocql's
+	// RetryPolicy is only ever consulted on error.
+	breaker *retry.CircuitBreakerPolicy
 )
 
 const insertQueryFormat = "insert into %s.%s (id,amount,state,time) values (?,?,?,?)"
 
 func init() {
-	cosmosCassandraContactPoint = os.Getenv("COSMOSDB_CASSANDRA_CONTACT_POINT")
-	cosmosCassandraUser = os.Getenv("COSMOSDB_CASSANDRA_USER")
-	cosmosCassandraPassword = os.Getenv("COSMOSDB_CASSANDRA_PASSWORD")
-	keyspace = os.Getenv("COSMOSDB_CASSANDRA_KEYSPACE")
-	table = os.Getenv("COSMOSDB_CASSANDRA_TABLE")
-
-	if cosmosCassandraContactPoint == "" || cosmosCassandraUser == "" || cosmosCassandraPassword == "" {
-		log.Fatal("missing mandatory environment variables")
-	}
-
-	useRetryEnvVar := os.Getenv("USE_RETRY_POLICY")
-	if useRetryEnvVar == "" {
-		useRetryEnvVar = "true"
+	configPath := os.Getenv("CONFIG_FILE")
+	if configPath == "" {
+		configPath = "config.yaml"
 	}
 
 	var err error
-	useRetryPolicy, err = strconv.ParseBool(useRetryEnvVar)
+	cfg, err = config.Load(configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	clusterConfig := gocql.NewCluster(cosmosCassandraContactPoint)
-	clusterConfig.Port = 10350
-	clusterConfig.Authenticator = gocql.PasswordAuthenticator{Username: cosmosCassandraUser, Password: cosmosCassandraPassword}
-	clusterConfig.SslOpts = &gocql.SslOptions{Config: &tls.Config{MinVersion: tls.VersionTLS12}}
+	targetRUPerSec := getFloatEnv("TARGET_RU_PER_SEC", 1000)
+	ceilingRUPerSec := getFloatEnv("CEILING_RU_PER_SEC", 4000)
+	limiter = ratelimit.NewTokenBucketAIMD(ratelimit.AIMDConfig{
+		InitialRatePerSec:      targetRUPerSec,
+		CeilingRatePerSec:      ceilingRUPerSec,
+		MinRatePerSec:          targetRUPerSec * 0.1,
+		AdditiveIncrease:       targetRUPerSec * 0.05,
+		MultiplicativeDecrease: 0.5,
+	})
+
+	cluster := cfg.BuildCluster()
+	if b, ok := cluster.RetryPolicy.(*retry.CircuitBreakerPolicy); ok {
+		breaker = b
+	}
 
-	//log.Println("USE_RETRY_POLICY ==", useRetryPolicy)
-	if useRetryPolicy {
-		maxRetries := os.Getenv("MAX_RETRIES")
-		if maxRetries == "" {
-			maxRetries = "5"
-		}
-		//log.Println("MAX_RETRIES ==", maxRetries)
-		numRetries, err := strconv.Atoi(maxRetries)
-		if err != nil {
-			log.Fatal(err)
+	// Detect the shard count before CreateSession, since CreateSession fills
+	// the initial per-host connection pool synchronously through
+	// cluster.Dialer - by the time it returns, those connections are already
+	// dialed, and setting the Dialer's shard count afterward is too late to
+	// steer any of them.
+	if d, ok := cluster.Dialer.(*shard.Dialer); ok {
+		if n, ok := detectNrShards(cluster); ok {
+			d.SetNrShards(n)
+			log.Printf("Shard-aware routing enabled: %d shards detected", n)
+		} else {
+			log.Print("SHARD_AWARE is set but the server did not advertise a shard count; falling back to plain token-aware routing")
 		}
-		clusterConfig.RetryPolicy = retry.NewCosmosRetryPolicy(numRetries)
 	}
 
-	clusterConfig.ProtoVersion = 4
-	clusterConfig.ConnectTimeout = 3 * time.Second
-	clusterConfig.Timeout = 3 * time.Second
-
-	cs, err = clusterConfig.CreateSession()
+	cs, err = cluster.CreateSession()
 	if err != nil {
 		log.Fatal("Failed to connect to Azure Cosmos DB", err)
 	}
 	log.Print("Connected to Azure Cosmos DB")
 
-	insertQuery = fmt.Sprintf(insertQueryFormat, keyspace, table)
+	insertQuery = fmt.Sprintf(insertQueryFormat, cfg.Schema.Keyspace, cfg.Schema.Table)
+}
+
+// detectNrShards opens a short-lived bootstrap session (a single connection
+// is enough) to run shard.DetectNrShards before the real session's pool
+// fills, since that pool fill is what shard-aware dialing needs to steer.
+func detectNrShards(cluster *gocql.ClusterConfig) (uint16, bool) {
+	bootstrap := *cluster
+	bootstrap.NumConns = 1
+
+	session, err := bootstrap.CreateSession()
+	if err != nil {
+		return 0, false
+	}
+	defer session.Close()
+
+	return shard.DetectNrShards(context.Background(), session)
+}
+
+// getFloatEnv reads a float64 from the named environment variable, falling
+// back to def when unset or unparseable.
+func getFloatEnv(name string, def float64) float64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("invalid value for %s, using default %v", name, def)
+		return def
+	}
+	return f
 }
 
 func main() {
-	http.HandleFunc("/orders", Add)
+	http.HandleFunc("/orders", Orders)
+	http.HandleFunc("/orders/bulk", BulkAdd)
+	http.HandleFunc("/orders/", GetOrder)
+	http.HandleFunc("/ratelimit/metrics", RateLimitMetrics)
 	s := http.Server{Addr: ":8080", Handler: nil}
 
 	go func() {
 		log.Fatal(s.ListenAndServe())
 	}()
 
-	exit := make(chan os.Signal)
+	exit := make(chan os.Signal, 1)
 	signal.Notify(exit, syscall.SIGINT, syscall.SIGTERM)
 
 	<-exit
@@ -110,12 +142,30 @@ func main() {
 
 const fixedLocation = "Seattle"
 
+// Orders dispatches /orders by method: POST adds a new record, GET lists
+// existing ones.
+func Orders(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		ListOrders(rw, req)
+	case http.MethodPost:
+		Add(rw, req)
+	default:
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 // Add adds a new record in Cosmos DB table
 func Add(rw http.ResponseWriter, req *http.Request) {
 
 	rid, _ := uuid.GenerateUUID()
 
-	err := cs.Query(insertQuery).Bind(rid, rand.Intn(200)+50, fixedLocation, time.Now()).Observer(OrderInsertErrorLogger{orderID: rid}).Exec()
+	if err := limiter.Acquire(req.Context()); err != nil {
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	err := cs.Query(insertQuery).Bind(rid, rand.Intn(200)+50, fixedLocation, time.Now()).WithContext(req.Context()).Observer(OrderInsertErrorLogger{orderID: rid}).Exec()
 
 	if err != nil {
 
@@ -137,7 +187,8 @@ type OrderInsertErrorLogger struct {
 	orderID string
 }
 
-// ObserveQuery logs query error
+// ObserveQuery logs query error and feeds 429/success signals into the rate
+// limiter's AIMD controller.
 func (l OrderInsertErrorLogger) ObserveQuery(ctx context.Context, oq gocql.ObservedQuery) {
 	err := oq.Err
 	if err != nil {
@@ -145,5 +196,25 @@ func (l OrderInsertErrorLogger) ObserveQuery(ctx context.Context, oq gocql.Obser
 		if oq.Attempt > 0 {
 			log.Printf("Order %s is being retried. attempt #%v", l.orderID, oq.Attempt)
 		}
+		if strings.Contains(err.Error(), "TooManyRequests (429)") {
+			limiter.OnThrottled(ratelimit.ParseRetryAfter(err.Error(), time.Second))
+		}
+		return
 	}
+	limiter.OnSuccess()
+	if breaker != nil {
+		breaker.RecordSuccess()
+	}
+}
+
+// RateLimitMetrics exposes the adaptive rate limiter's current state
+// (fill rate, tokens available, 429 count) as Prometheus-style gauges.
+func RateLimitMetrics(rw http.ResponseWriter, req *http.Request) {
+	m := limiter.Metrics()
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string]any{
+		"current_rate_per_sec": m.CurrentRatePerSec,
+		"tokens_available":     m.TokensAvailable,
+		"throttled_count":      m.ThrottledCount,
+	})
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/abhirockzz/cosmos-go-rate-limiting/cqljson"
+)
+
+const (
+	selectAllQuery = "select id,amount,state,time from %s.%s"
+	selectOneQuery = "select id,amount,state,time from %s.%s where id = ?"
+
+	defaultPageSize = 20
+)
+
+// ListOrders handles GET /orders, returning every row as JSON via cqljson.
+// Results are paginated through gocql's PageState, surfaced as
+// ?page_size= and ?page_token= query params; the response carries the next
+// page's token (if any) in the X-Next-Page-Token header.
+func ListOrders(rw http.ResponseWriter, req *http.Request) {
+	pageSize := defaultPageSize
+	if v := req.URL.Query().Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(rw, "invalid page_size", http.StatusBadRequest)
+			return
+		}
+		pageSize = n
+	}
+
+	var pageState []byte
+	if v := req.URL.Query().Get("page_token"); v != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			http.Error(rw, "invalid page_token", http.StatusBadRequest)
+			return
+		}
+		pageState = decoded
+	}
+
+	cql := fmt.Sprintf(selectAllQuery, cfg.Schema.Keyspace, cfg.Schema.Table)
+	rows, nextPageState, err := cqljson.QueryPage(cs, cql, pageSize, pageState)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(nextPageState) > 0 {
+		rw.Header().Set("X-Next-Page-Token", base64.RawURLEncoding.EncodeToString(nextPageState))
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(rows)
+}
+
+// GetOrder handles GET /orders/{id}, returning a single row as JSON.
+func GetOrder(rw http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, "/orders/")
+	if id == "" {
+		http.Error(rw, "missing order id", http.StatusBadRequest)
+		return
+	}
+
+	cql := fmt.Sprintf(selectOneQuery, cfg.Schema.Keyspace, cfg.Schema.Table)
+	rows, err := cqljson.Query(cs, cql, id)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(rows) == 0 {
+		http.Error(rw, "order not found", http.StatusNotFound)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(rows[0])
+}
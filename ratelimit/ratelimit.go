@@ -0,0 +1,234 @@
+// Package ratelimit implements a client-side adaptive rate limiter for the
+// Cosmos DB Cassandra API. It proactively throttles outgoing queries before
+// Cosmos DB has a chance to respond with 429 (TooManyRequests), using a
+// token bucket whose fill rate is adjusted by an AIMD (additive-increase,
+// multiplicative-decrease) controller.
+package ratelimit
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limiter is implemented by anything that can gate outgoing requests.
+type Limiter interface {
+	// Acquire blocks until a token is available or ctx is done, whichever
+	// happens first.
+	Acquire(ctx context.Context) error
+
+	// OnSuccess reports a successful query so the controller can grow the
+	// fill rate.
+	OnSuccess()
+
+	// OnThrottled reports a server-side 429 and the RetryAfterMs the server
+	// asked the client to wait, so the controller can back off and cool
+	// down before resuming growth.
+	OnThrottled(retryAfter time.Duration)
+
+	// Metrics returns a snapshot of the limiter's current state, suitable
+	// for exposing as Prometheus gauges/counters.
+	Metrics() Metrics
+}
+
+// Metrics is a point-in-time snapshot of a Limiter's internal state.
+type Metrics struct {
+	// CurrentRatePerSec is the current token fill rate.
+	CurrentRatePerSec float64
+	// TokensAvailable is the number of tokens currently in the bucket.
+	TokensAvailable float64
+	// ThrottledCount is the number of times OnThrottled has been called.
+	ThrottledCount uint64
+}
+
+// Clock abstracts time so tests can drive the controller with a fake clock
+// instead of sleeping in real time.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// AIMDConfig configures the token-bucket AIMD controller.
+type AIMDConfig struct {
+	// InitialRatePerSec is the starting token fill rate, in RU/s.
+	InitialRatePerSec float64
+	// CeilingRatePerSec caps how high the additive-increase can grow the
+	// fill rate.
+	CeilingRatePerSec float64
+	// MinRatePerSec is a floor so the multiplicative-decrease never stalls
+	// the limiter entirely.
+	MinRatePerSec float64
+	// AdditiveIncrease is added to the fill rate, in RU/s, on every
+	// OnSuccess call, e.g. 5% of InitialRatePerSec.
+	AdditiveIncrease float64
+	// MultiplicativeDecrease scales the fill rate down on a 429, e.g. 0.5
+	// to halve it.
+	MultiplicativeDecrease float64
+	// BurstSize is the token bucket's capacity.
+	BurstSize float64
+	// Clock is used for scheduling; defaults to the real wall clock.
+	Clock Clock
+}
+
+// TokenBucketAIMD is a per-session rate limiter backed by a token bucket
+// whose fill rate is tuned by an AIMD controller.
+type TokenBucketAIMD struct {
+	mu sync.Mutex
+
+	rate    float64
+	ceiling float64
+	min     float64
+	add     float64
+	mul     float64
+	burst   float64
+
+	tokens     float64
+	lastRefill time.Time
+	cooldownAt time.Time
+
+	throttled uint64
+
+	clock Clock
+}
+
+// NewTokenBucketAIMD creates a Limiter seeded with cfg. A nil Clock defaults
+// to the real wall clock and a zero BurstSize to InitialRatePerSec; other
+// zero-valued fields are used as given. The bucket starts full.
+func NewTokenBucketAIMD(cfg AIMDConfig) *TokenBucketAIMD {
+	clock := cfg.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	if cfg.BurstSize <= 0 {
+		cfg.BurstSize = cfg.InitialRatePerSec
+	}
+	return &TokenBucketAIMD{
+		rate:       cfg.InitialRatePerSec,
+		ceiling:    cfg.CeilingRatePerSec,
+		min:        cfg.MinRatePerSec,
+		add:        cfg.AdditiveIncrease,
+		mul:        cfg.MultiplicativeDecrease,
+		burst:      cfg.BurstSize,
+		tokens:     cfg.BurstSize,
+		lastRefill: clock.Now(),
+		clock:      clock,
+	}
+}
+
+// Acquire blocks until a token is available or ctx is cancelled.
+func (l *TokenBucketAIMD) Acquire(ctx context.Context) error {
+	for {
+		wait, ok := l.tryTake()
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (l *TokenBucketAIMD) tryTake() (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.refillLocked(now)
+
+	if now.Before(l.cooldownAt) {
+		return l.cooldownAt.Sub(now), false
+	}
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+
+	missing := 1 - l.tokens
+	rate := l.rate
+	if rate <= 0 {
+		rate = l.min
+	}
+	return time.Duration(missing / rate * float64(time.Second)), false
+}
+
+func (l *TokenBucketAIMD) refillLocked(now time.Time) {
+	elapsed := now.Sub(l.lastRefill).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	l.tokens += elapsed * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.lastRefill = now
+}
+
+// OnSuccess nudges the fill rate up by the additive increase, capped at the
+// configured ceiling.
+func (l *TokenBucketAIMD) OnSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate += l.add
+	if l.ceiling > 0 && l.rate > l.ceiling {
+		l.rate = l.ceiling
+	}
+}
+
+// OnThrottled scales the fill rate by MultiplicativeDecrease (floored at
+// MinRatePerSec) and opens a cooldown window for retryAfter, mirroring the
+// server's RetryAfterMs.
+func (l *TokenBucketAIMD) OnThrottled(retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.throttled++
+	l.rate *= l.mul
+	if l.rate < l.min {
+		l.rate = l.min
+	}
+	cooldownUntil := l.clock.Now().Add(retryAfter)
+	if cooldownUntil.After(l.cooldownAt) {
+		l.cooldownAt = cooldownUntil
+	}
+}
+
+// Metrics returns a snapshot of the limiter's current state.
+func (l *TokenBucketAIMD) Metrics() Metrics {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return Metrics{
+		CurrentRatePerSec: l.rate,
+		TokensAvailable:   l.tokens,
+		ThrottledCount:    l.throttled,
+	}
+}
+
+// retryAfterMsPattern extracts the server-advised RetryAfterMs from a gocql
+// error body, e.g. "...TooManyRequests (429)... RetryAfterMs=100...".
+var retryAfterMsPattern = regexp.MustCompile(`RetryAfterMs=(\d+)`)
+
+// ParseRetryAfter extracts the RetryAfterMs value from a Cosmos DB 429 error
+// message, falling back to def when the message doesn't carry one.
+func ParseRetryAfter(errMsg string, def time.Duration) time.Duration {
+	m := retryAfterMsPattern.FindStringSubmatch(errMsg)
+	if m == nil {
+		return def
+	}
+	ms, err := strconv.Atoi(m[1])
+	if err != nil {
+		return def
+	}
+	return time.Duration(ms) * time.Millisecond
+}
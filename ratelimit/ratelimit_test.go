@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose Now() only advances when the test tells it to,
+// so AIMD timing math can be exercised without sleeping in real time.
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+func (c *fakeClock) Sleep(d time.Duration) { c.Advance(d) }
+
+func newTestLimiter(clock *fakeClock) *TokenBucketAIMD {
+	return NewTokenBucketAIMD(AIMDConfig{
+		InitialRatePerSec:      10,
+		CeilingRatePerSec:      40,
+		MinRatePerSec:          1,
+		AdditiveIncrease:       2,
+		MultiplicativeDecrease: 0.5,
+		BurstSize:              5,
+		Clock:                  clock,
+	})
+}
+
+func TestOnSuccessIncreasesRateUpToCeiling(t *testing.T) {
+	clock := newFakeClock()
+	l := newTestLimiter(clock)
+
+	l.OnSuccess()
+	if got, want := l.Metrics().CurrentRatePerSec, 12.0; got != want {
+		t.Fatalf("rate after one OnSuccess = %v, want %v", got, want)
+	}
+
+	// 15 more successes would overshoot the ceiling (12 + 15*2 = 42 > 40);
+	// the controller must clamp at CeilingRatePerSec instead.
+	for i := 0; i < 15; i++ {
+		l.OnSuccess()
+	}
+	if got, want := l.Metrics().CurrentRatePerSec, 40.0; got != want {
+		t.Fatalf("rate after repeated OnSuccess = %v, want ceiling %v", got, want)
+	}
+}
+
+func TestOnThrottledHalvesRateDownToFloor(t *testing.T) {
+	clock := newFakeClock()
+	l := newTestLimiter(clock)
+
+	l.OnThrottled(100 * time.Millisecond)
+	if got, want := l.Metrics().CurrentRatePerSec, 5.0; got != want {
+		t.Fatalf("rate after one OnThrottled = %v, want %v", got, want)
+	}
+
+	// Keep halving; it must floor at MinRatePerSec rather than drift below it.
+	for i := 0; i < 10; i++ {
+		l.OnThrottled(0)
+	}
+	if got, want := l.Metrics().CurrentRatePerSec, 1.0; got != want {
+		t.Fatalf("rate after repeated OnThrottled = %v, want floor %v", got, want)
+	}
+
+	if got := l.Metrics().ThrottledCount; got != 11 {
+		t.Fatalf("ThrottledCount = %d, want 11", got)
+	}
+}
+
+func TestOnThrottledSetsCooldownBlockingAcquire(t *testing.T) {
+	clock := newFakeClock()
+	l := newTestLimiter(clock)
+
+	l.OnThrottled(50 * time.Millisecond)
+
+	// The cooldown must block tryTake even though the bucket still has its
+	// full initial burst of tokens available.
+	if wait, ok := l.tryTake(); ok || wait <= 0 {
+		t.Fatalf("tryTake during cooldown = (%v, %v), want a positive wait and ok=false", wait, ok)
+	}
+
+	clock.Advance(50 * time.Millisecond)
+	if _, ok := l.tryTake(); !ok {
+		t.Fatalf("tryTake after cooldown elapsed: expected a token to be available")
+	}
+}
+
+func TestRefillRespectsRateAndBurstCap(t *testing.T) {
+	clock := newFakeClock()
+	l := newTestLimiter(clock)
+
+	for i := 0; i < 5; i++ {
+		if _, ok := l.tryTake(); !ok {
+			t.Fatalf("tryTake %d: expected initial burst to supply a token", i)
+		}
+	}
+	if _, ok := l.tryTake(); ok {
+		t.Fatalf("tryTake: expected bucket to be empty after draining the burst")
+	}
+
+	// At the initial rate of 10/sec, a full second would refill 10 tokens,
+	// but the bucket must stop at its burst cap of 5.
+	clock.Advance(time.Second)
+	for i := 0; i < 5; i++ {
+		if _, ok := l.tryTake(); !ok {
+			t.Fatalf("tryTake %d after refill: expected a token to be available", i)
+		}
+	}
+	if _, ok := l.tryTake(); ok {
+		t.Fatalf("tryTake: refill must not exceed the burst cap")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		errMsg string
+		def    time.Duration
+		want   time.Duration
+	}{
+		{
+			name:   "parses RetryAfterMs",
+			errMsg: "gocql: Cassandra failure during write query... TooManyRequests (429)... RetryAfterMs=250",
+			def:    time.Second,
+			want:   250 * time.Millisecond,
+		},
+		{
+			name:   "falls back without a match",
+			errMsg: "gocql: some other error",
+			def:    750 * time.Millisecond,
+			want:   750 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ParseRetryAfter(tc.errMsg, tc.def); got != tc.want {
+				t.Fatalf("ParseRetryAfter(%q, %v) = %v, want %v", tc.errMsg, tc.def, got, tc.want)
+			}
+		})
+	}
+}
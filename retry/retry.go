@@ -0,0 +1,239 @@
+// Package retry implements gocql.RetryPolicy strategies tuned for Azure
+// Cosmos DB's Cassandra API, where the dominant failure mode is a
+// throttling 429 (TooManyRequests) that carries a server-advised
+// RetryAfterMs the client should honor before retrying.
+//
+// This package used to live in a separate extension repo and was imported
+// as github.com/abhirockzz/cosmos-cassandra-go-extension/retry; it has been
+// folded into this module so the new jitter and circuit-breaker policies
+// below can be added and selected alongside it.
+package retry
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// CosmosRetryPolicy retries up to NumRetries times. Between attempts it
+// sleeps GrowingBackoff*attempt if set, otherwise FixedBackoff; gocql's
+// RetryPolicy.Attempt isn't given the triggering error, so it can't key off
+// the server's RetryAfterMs directly the way the adaptive rate limiter's
+// QueryObserver does.
+type CosmosRetryPolicy struct {
+	NumRetries     int
+	GrowingBackoff time.Duration
+	FixedBackoff   time.Duration
+}
+
+// NewCosmosRetryPolicy creates a CosmosRetryPolicy that retries up to
+// numRetries times with a 1s fixed backoff between attempts.
+func NewCosmosRetryPolicy(numRetries int) *CosmosRetryPolicy {
+	return &CosmosRetryPolicy{NumRetries: numRetries, FixedBackoff: time.Second}
+}
+
+// Attempt implements gocql.RetryPolicy.
+func (p *CosmosRetryPolicy) Attempt(q gocql.RetryableQuery) bool {
+	if q.Attempts() > p.NumRetries {
+		return false
+	}
+	switch {
+	case p.GrowingBackoff > 0:
+		time.Sleep(time.Duration(q.Attempts()) * p.GrowingBackoff)
+	case p.FixedBackoff > 0:
+		time.Sleep(p.FixedBackoff)
+	}
+	return true
+}
+
+// GetRetryType implements gocql.RetryPolicy. Cosmos DB throttling and
+// timeouts are both safe to retry.
+func (p *CosmosRetryPolicy) GetRetryType(err error) gocql.RetryType {
+	return gocql.Retry
+}
+
+// ExponentialJitterPolicy implements decorrelated-jitter backoff:
+// sleep = min(Cap, random(Base, prev*3)), as described in
+// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/.
+// A single policy instance is shared by every query on the cluster, so
+// "prev" can't be a mutable field on the policy itself - concurrent queries
+// would stomp on each other's backoff state. Instead each call derives prev
+// from q.Attempts(), which gocql tracks per query, keeping the policy
+// itself stateless and safe for concurrent use.
+type ExponentialJitterPolicy struct {
+	Base       time.Duration
+	Max        time.Duration
+	Cap        time.Duration
+	NumRetries int
+}
+
+// NewExponentialJitterPolicy creates a decorrelated-jitter backoff policy.
+// base is the lower bound of every sleep, cap bounds every sleep, max is kept for
+// sibling-API symmetry with CosmosRetryPolicy's single-duration knobs and
+// defaults to cap when zero, and n is the maximum number of retries.
+func NewExponentialJitterPolicy(base, max, cap time.Duration, n int) *ExponentialJitterPolicy {
+	if max == 0 {
+		max = cap
+	}
+	return &ExponentialJitterPolicy{Base: base, Max: max, Cap: cap, NumRetries: n}
+}
+
+// Attempt implements gocql.RetryPolicy.
+func (p *ExponentialJitterPolicy) Attempt(q gocql.RetryableQuery) bool {
+	if q.Attempts() > p.NumRetries {
+		return false
+	}
+	sleep := p.nextSleep(q.Attempts())
+	time.Sleep(sleep)
+	return true
+}
+
+// nextSleep computes the decorrelated-jitter sleep for the attempt'th retry
+// of a single query's chain: prev is reconstructed as min(Cap, Base*3^n)
+// rather than carried in a shared field, so concurrent queries never see
+// each other's backoff state.
+func (p *ExponentialJitterPolicy) nextSleep(attempt int) time.Duration {
+	lo := int64(p.Base)
+	prev := lo
+	for i := 0; i < attempt; i++ {
+		prev *= 3
+		if prev <= 0 || prev > int64(p.Cap) {
+			prev = int64(p.Cap)
+			break
+		}
+	}
+	hi := prev * 3
+	if hi <= lo || hi <= 0 {
+		hi = lo + 1
+	}
+	sleep := time.Duration(lo + rand.Int63n(hi-lo))
+	if sleep > p.Cap {
+		sleep = p.Cap
+	}
+	return sleep
+}
+
+// GetRetryType implements gocql.RetryPolicy.
+func (p *ExponentialJitterPolicy) GetRetryType(err error) gocql.RetryType {
+	return gocql.Retry
+}
+
+// circuitState is the circuit breaker's current state.
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// CircuitBreakerPolicy wraps an inner gocql.RetryPolicy and stops attempting
+// retries once FailureThreshold consecutive queries have run out of Inner's
+// retries with no RecordSuccess in between. Every error kind counts the
+// same: Attempt is not given the error, so 429s and timeouts are not told
+// apart from other failures. The open breaker gives the cluster OpenDuration to recover before a single half-open
+// probe query is allowed through. A single instance is shared across every
+// concurrent query on the cluster and RecordSuccess is called from a
+// separate observer goroutine, so the state machine below is guarded by mu.
+type CircuitBreakerPolicy struct {
+	Inner            gocql.RetryPolicy
+	FailureThreshold int
+	OpenDuration     time.Duration
+
+	mu               sync.Mutex
+	state            circuitState
+	consecutiveFails int
+	openedAt         time.Time
+	probeInFlight    bool
+}
+
+// NewCircuitBreakerPolicy wraps inner with a circuit breaker that opens
+// after failureThreshold consecutive failures and stays open for
+// openDuration before allowing a single half-open probe.
+func NewCircuitBreakerPolicy(inner gocql.RetryPolicy, failureThreshold int, openDuration time.Duration) *CircuitBreakerPolicy {
+	return &CircuitBreakerPolicy{Inner: inner, FailureThreshold: failureThreshold, OpenDuration: openDuration}
+}
+
+// Attempt implements gocql.RetryPolicy, short-circuiting to false while the
+// breaker is open. Inner.Attempt may sleep, so it's called without mu held.
+func (p *CircuitBreakerPolicy) Attempt(q gocql.RetryableQuery) bool {
+	if !p.admit() {
+		return false
+	}
+
+	if !p.Inner.Attempt(q) {
+		p.recordFailure()
+		return false
+	}
+	return true
+}
+
+// admit reports whether a query attempt may proceed, transitioning an
+// expired open breaker to half-open and admitting at most one probe while
+// half-open.
+func (p *CircuitBreakerPolicy) admit() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch p.state {
+	case circuitOpen:
+		if time.Since(p.openedAt) < p.OpenDuration {
+			return false
+		}
+		p.state = circuitHalfOpen
+		p.probeInFlight = false
+		fallthrough
+	case circuitHalfOpen:
+		if p.probeInFlight {
+			return false
+		}
+		p.probeInFlight = true
+	}
+	return true
+}
+
+// recordFailure tracks consecutive failures and trips the breaker once
+// FailureThreshold is reached; a failed half-open probe re-opens it
+// immediately.
+func (p *CircuitBreakerPolicy) recordFailure() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.state == circuitHalfOpen {
+		p.tripLocked()
+		return
+	}
+	p.consecutiveFails++
+	if p.consecutiveFails >= p.FailureThreshold {
+		p.tripLocked()
+	}
+}
+
+// tripLocked opens the breaker. Callers must hold mu.
+func (p *CircuitBreakerPolicy) tripLocked() {
+	p.state = circuitOpen
+	p.openedAt = time.Now()
+	p.consecutiveFails = 0
+	p.probeInFlight = false
+}
+
+// RecordSuccess closes the breaker again after a successful query,
+// completing the half-open probe. gocql's RetryPolicy is only consulted on
+// error, so callers should invoke this from a gocql.QueryObserver (the way
+// this service's OrderInsertErrorLogger already tracks success/failure for
+// the adaptive rate limiter) rather than relying on the policy alone.
+func (p *CircuitBreakerPolicy) RecordSuccess() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.state = circuitClosed
+	p.consecutiveFails = 0
+	p.probeInFlight = false
+}
+
+// GetRetryType implements gocql.RetryPolicy, delegating to Inner.
+func (p *CircuitBreakerPolicy) GetRetryType(err error) gocql.RetryType {
+	return p.Inner.GetRetryType(err)
+}
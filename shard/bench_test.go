@@ -0,0 +1,104 @@
+package shard_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/abhirockzz/cosmos-go-rate-limiting/shard"
+	"github.com/gocql/gocql"
+)
+
+// These benchmarks compare plain token-aware routing against token+shard
+// awareness against a real cluster, so they're gated behind
+// CASSANDRA_TEST_HOSTS rather than running (and failing to connect) by
+// default:
+//
+//	CASSANDRA_TEST_HOSTS=127.0.0.1 go test ./shard/ -bench . -benchtime 5s
+const benchKeyspace = "shard_bench"
+const benchTable = "items"
+
+func testHosts(b *testing.B) []string {
+	b.Helper()
+	hosts := os.Getenv("CASSANDRA_TEST_HOSTS")
+	if hosts == "" {
+		b.Skip("CASSANDRA_TEST_HOSTS not set; skipping benchmark against a local Cassandra")
+	}
+	return strings.Split(hosts, ",")
+}
+
+// connect builds a cluster with shard-aware dialing enabled or disabled,
+// detects the shard count before CreateSession fills the pool (mirroring
+// main.go's init), and returns a ready-to-use session.
+func connect(b *testing.B, shardAware bool) *gocql.Session {
+	b.Helper()
+
+	cluster := gocql.NewCluster(testHosts(b)...)
+	cluster.NumConns = 4
+	shard.Apply(cluster, shard.Config{Enabled: shardAware})
+
+	if d, ok := cluster.Dialer.(*shard.Dialer); ok {
+		bootstrap := *cluster
+		bootstrap.NumConns = 1
+		bs, err := bootstrap.CreateSession()
+		if err != nil {
+			b.Fatalf("bootstrap session: %v", err)
+		}
+		if n, ok := shard.DetectNrShards(context.Background(), bs); ok {
+			d.SetNrShards(n)
+		}
+		bs.Close()
+	}
+
+	session, err := cluster.CreateSession()
+	if err != nil {
+		b.Fatalf("connecting to %v: %v", testHosts(b), err)
+	}
+	return session
+}
+
+func setupSchema(b *testing.B, session *gocql.Session) {
+	b.Helper()
+
+	stmts := []string{
+		fmt.Sprintf(`create keyspace if not exists %s with replication = {'class': 'SimpleStrategy', 'replication_factor': 1}`, benchKeyspace),
+		fmt.Sprintf(`create table if not exists %s.%s (id text primary key, value int)`, benchKeyspace, benchTable),
+	}
+	for _, stmt := range stmts {
+		if err := session.Query(stmt).Exec(); err != nil {
+			b.Fatalf("schema setup %q: %v", stmt, err)
+		}
+	}
+}
+
+func runInsertBenchmark(b *testing.B, shardAware bool) {
+	session := connect(b, shardAware)
+	defer session.Close()
+
+	setupSchema(b, session)
+
+	insertQuery := fmt.Sprintf("insert into %s.%s (id, value) values (?, ?)", benchKeyspace, benchTable)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := fmt.Sprintf("bench-%d-%d", i, rand.Int63())
+		if err := session.Query(insertQuery, id, i).Exec(); err != nil {
+			b.Fatalf("insert: %v", err)
+		}
+	}
+}
+
+// BenchmarkInsert_TokenAwareOnly is the baseline: host-level token-aware
+// routing, no shard-aware dialing.
+func BenchmarkInsert_TokenAwareOnly(b *testing.B) {
+	runInsertBenchmark(b, false)
+}
+
+// BenchmarkInsert_TokenAndShardAware adds shard-aware dialing (round-robin
+// per-connection, see shard.Dialer) on top of token-aware host selection.
+func BenchmarkInsert_TokenAndShardAware(b *testing.B) {
+	runInsertBenchmark(b, true)
+}
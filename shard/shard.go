@@ -0,0 +1,198 @@
+// Package shard adds optional token-aware, shard-aware connection dialing
+// on top of gocql for Cosmos DB's Cassandra API (and ScyllaDB-compatible
+// clusters), using the shard-aware-port technique: a connection's local TCP
+// port is chosen so that (port % nrShards) == targetShard, steering the
+// connection straight to a given shard.
+//
+// gocql only calls a Dialer while filling a host's connection pool
+// (cluster.NumConns connections per host, opened at startup/reconnect); it
+// never consults the Dialer on a per-query basis, and which already-open
+// connection a query lands on is picked by gocql's unexported pool internals,
+// not by anything this package can influence. So Dialer steers at connection
+// open time, round-robining new connections across all known shards, rather
+// than targeting the shard that owns any particular query's partition -
+// raise cluster.NumConns to at least NrShards so that round-robin actually
+// reaches every shard. SetNrShards must also be called before
+// cluster.CreateSession, since that call fills the initial pool
+// synchronously through Dialer; calling it afterward only helps connections
+// opened by a later reconnect.
+package shard
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	"github.com/gocql/gocql"
+)
+
+// DefaultPort is the well-known shard-aware port ScyllaDB listens on in
+// addition to its regular CQL port.
+const DefaultPort = 19042
+
+// Config controls the cluster's host selection policy and whether
+// shard-aware routing is enabled and which port to dial it on.
+type Config struct {
+	// HostSelectionPolicy picks hosts for a query. Nil defaults to
+	// gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy()).
+	HostSelectionPolicy gocql.HostSelectionPolicy
+	Enabled             bool
+	Port                int
+}
+
+// Apply sets cluster's host selection policy (cfg.HostSelectionPolicy, or
+// token-aware round-robin by default) and, when cfg.Enabled, layers a
+// shard-aware Dialer on top. It's safe to call with cfg.Enabled false, in
+// which case cluster is left with plain host-selection-policy routing.
+func Apply(cluster *gocql.ClusterConfig, cfg Config) {
+	if cfg.HostSelectionPolicy != nil {
+		cluster.PoolConfig.HostSelectionPolicy = cfg.HostSelectionPolicy
+	} else {
+		cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy())
+	}
+
+	if !cfg.Enabled {
+		return
+	}
+
+	port := cfg.Port
+	if port <= 0 {
+		port = DefaultPort
+	}
+	cluster.Dialer = NewDialer(port)
+}
+
+// Dialer is a gocql.Dialer that, once the cluster's shard count is known
+// (see SetNrShards), binds each new connection's local port so that
+// (localPort % NrShards) == the next shard in round-robin order, spreading
+// a host's connection pool evenly across its shards. Until SetNrShards is
+// called, or when binding fails after the configured attempts, it falls
+// back to a plain dial so the connection still succeeds against servers
+// that don't advertise shard info.
+type Dialer struct {
+	// Port is the shard-aware CQL port to dial, instead of the regular one.
+	Port int
+	// MaxBindAttempts bounds how many local ports are tried before giving
+	// up and falling back to a plain dial. Defaults to 128.
+	MaxBindAttempts int
+
+	// nrShards is the number of shards the target node reports (see
+	// SetNrShards). DialContext reads it from the pool's connection
+	// goroutines, possibly while SetNrShards is running, so it's accessed
+	// atomically rather than as a plain field.
+	nrShards atomic.Uint32
+	// nextShard round-robins successive DialContext calls across shards.
+	nextShard atomic.Uint32
+
+	fallback net.Dialer
+}
+
+// NewDialer creates a Dialer that dials the shard-aware port. NrShards must
+// be set via SetNrShards (e.g. from DetectNrShards) before shard steering
+// takes effect.
+func NewDialer(port int) *Dialer {
+	return &Dialer{Port: port}
+}
+
+// SetNrShards records the cluster's shard count, enabling shard steering.
+// Safe to call concurrently with DialContext.
+func (d *Dialer) SetNrShards(n uint16) {
+	d.nrShards.Store(uint32(n))
+}
+
+// NrShards returns the shard count last recorded by SetNrShards, or 0 if
+// none has been set yet.
+func (d *Dialer) NrShards() uint16 {
+	return uint16(d.nrShards.Load())
+}
+
+// DialContext implements gocql.Dialer. It's called once per connection
+// gocql opens to fill out a host's pool, never per query, so it picks the
+// next shard in round-robin order rather than targeting any specific
+// query's partition.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	nrShards := d.NrShards()
+	if nrShards == 0 {
+		return d.fallback.DialContext(ctx, network, addr)
+	}
+
+	targetShard := uint16(d.nextShard.Add(1)-1) % nrShards
+	shardAddr := withPort(addr, d.Port)
+
+	maxAttempts := d.MaxBindAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 128
+	}
+
+	conn, err := d.dialFromShardPort(ctx, network, shardAddr, targetShard, nrShards, maxAttempts)
+	if err != nil {
+		// The node may not actually be shard-aware, or every candidate
+		// port may be taken; fall back rather than fail the connection.
+		return d.fallback.DialContext(ctx, network, addr)
+	}
+	return conn, nil
+}
+
+// dialFromShardPort tries local ports satisfying (port % NrShards) ==
+// targetShard until one binds and connects, or attempts are exhausted.
+func (d *Dialer) dialFromShardPort(ctx context.Context, network, addr string, targetShard, nrShards uint16, maxAttempts int) (net.Conn, error) {
+	localAddr := &net.TCPAddr{}
+
+	for i := 0; i < maxAttempts; i++ {
+		port := candidatePort(targetShard, nrShards, i)
+		localAddr.Port = port
+
+		dialer := net.Dialer{
+			Timeout:   d.fallback.Timeout,
+			LocalAddr: localAddr,
+		}
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err == nil {
+			return conn, nil
+		}
+		// Port in use or otherwise unavailable; try the next candidate.
+	}
+
+	return nil, fmt.Errorf("shard: no local port bound to shard %d after %d attempts", targetShard, maxAttempts)
+}
+
+// candidatePort returns the i-th ephemeral port p such that
+// p % nrShards == targetShard. Every step adds nrShards, which preserves
+// that invariant; the base itself has to be nudged up from ephemeralBase by
+// however much is needed to land on the right residue, since ephemeralBase
+// % nrShards is not generally 0.
+func candidatePort(targetShard uint16, nrShards uint16, i int) int {
+	const ephemeralBase = 32768
+	const ephemeralTop = 60999
+
+	step := int(nrShards)
+	offset := ((int(targetShard) - ephemeralBase%step) % step + step) % step
+	base := ephemeralBase + offset
+
+	maxSteps := (ephemeralTop - base) / step
+	return base + (i%(maxSteps+1))*step
+}
+
+func withPort(addr string, port int) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.JoinHostPort(host, fmt.Sprint(port))
+}
+
+// DetectNrShards queries a freshly connected session for the number of
+// shards the coordinator node reports, returning ok=false when the server
+// doesn't advertise shard info (e.g. plain Cassandra, or Cosmos DB's
+// Cassandra API).
+func DetectNrShards(ctx context.Context, session *gocql.Session) (nrShards uint16, ok bool) {
+	var n int
+	if err := session.Query("SELECT shard_count FROM system.local").WithContext(ctx).Scan(&n); err != nil {
+		return 0, false
+	}
+	if n <= 0 {
+		return 0, false
+	}
+	return uint16(n), true
+}